@@ -0,0 +1,36 @@
+package html
+
+import "fmt"
+
+// Error is returned by Parse, ParseFragment and Tokenizer.Parse when
+// malformed input is encountered. It pinpoints the offending byte in the
+// original source and names the element that was being parsed at the time.
+type Error struct {
+	Offset int // byte offset into the original input
+
+	Line int // 1-based line number
+	Col  int // 1-based column number
+
+	Element string // tag name of the element whose tag or contents were being parsed, or "" if none is known
+	Msg     string
+}
+
+func (e *Error) Error() string {
+	if e.Element != "" {
+		return fmt.Sprintf("%s (in %q element, at line %d, column %d)", e.Msg, e.Element, e.Line, e.Col)
+	}
+	return fmt.Sprintf("%s (at line %d, column %d)", e.Msg, e.Line, e.Col)
+}
+
+// errorf builds an *Error at the parser's current position, with element
+// naming the element whose tag or contents were being parsed (or "" if none
+// is known, e.g. for a start tag with no name).
+func (p *parser) errorf(element, format string, args ...interface{}) *Error {
+	return &Error{
+		Offset:  p.offset,
+		Line:    p.line,
+		Col:     p.col,
+		Element: element,
+		Msg:     fmt.Sprintf(format, args...),
+	}
+}
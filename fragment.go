@@ -0,0 +1,86 @@
+package html
+
+import (
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ParseFragment parses text as though it were the contents of context,
+// returning the nodes that would have been inserted without attaching them
+// to context or anywhere else. context governs the initial insertion mode:
+// a <title> or <textarea> context parses text as escapable raw text,
+// <script>/<style>/<xmp> parse it as raw text, an SVG or MathML context
+// (identified by context.Namespace) parses it in foreign mode — tagging
+// every element parsed with the same Namespace — and anything else is
+// parsed normally. context may be nil, which behaves the same as an
+// ordinary HTML element context.
+//
+// This matches the semantics that browsers give `innerHTML` and that
+// html5lib-tests' #document-fragment cases assume.
+func ParseFragment(context *html.Node, text []byte) ([]*html.Node, error) {
+	return ParseOptions{}.ParseFragment(context, text)
+}
+
+// ParseFragment is like the package-level ParseFragment, but parses with the
+// given options.
+func (opts ParseOptions) ParseFragment(context *html.Node, text []byte) ([]*html.Node, error) {
+	tok := &Tokenizer{buf: text, eof: true, line: 1, col: 1}
+	p := &parser{Tokenizer: tok, text: tok.window(), opts: opts}
+
+	root := p.newNode()
+	root.Type = html.ElementNode
+	if context != nil {
+		root.Data = context.Data
+		root.DataAtom = context.DataAtom
+		root.Namespace = context.Namespace
+	}
+
+	var err error
+	switch cat, foreignNS := fragmentCategory(context, opts); cat {
+	case catRaw:
+		err = p.parseRaw(root, false, true)
+	case catEscapableRaw:
+		err = p.parseRaw(root, true, true)
+	default:
+		p.foreignNS = foreignNS
+		err = p.parse(root, true)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var children []*html.Node
+	for c := root.FirstChild; c != nil; {
+		next := c.NextSibling
+		root.RemoveChild(c)
+		children = append(children, c)
+		c = next
+	}
+	return children, nil
+}
+
+// fragmentCategory determines the insertion mode a fragment parse should
+// start in, based on the context element it's being parsed into. foreignNS
+// is "svg" or "math" when cat is catForeign, identifying the namespace new
+// elements should be tagged with, and "" otherwise.
+func fragmentCategory(context *html.Node, opts ParseOptions) (cat category, foreignNS string) {
+	if context == nil {
+		return catNormal, ""
+	}
+	if context.Namespace == "svg" || context.Namespace == "math" {
+		return catForeign, context.Namespace
+	}
+	switch context.DataAtom {
+	case atom.Title, atom.Textarea:
+		return catEscapableRaw, ""
+	case atom.Script, atom.Style, atom.Xmp:
+		return catRaw, ""
+	case atom.Noscript:
+		if opts.Scripting {
+			return catRaw, ""
+		}
+		return catNormal, ""
+	default:
+		return catNormal, ""
+	}
+}
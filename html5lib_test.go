@@ -0,0 +1,118 @@
+package html
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"github.com/silversquirl/htmlparse/internal/html5libtest"
+)
+
+// TestHTML5Lib runs the html5lib-tests tree-construction corpus against Parse
+// and ParseFragment, comparing the resulting tree dump against each case's
+// #document section. The upstream corpus isn't vendored wholesale; cases
+// under testdata/html5lib-tests/ are hand-written in the same .dat format,
+// covering simple trees and fragment contexts (including foreign SVG/MathML
+// contexts and scripting toggled via #script-on/#script-off).
+//
+// #errors is parsed but not compared: upstream expects a list of per-position
+// parse errors, while this parser stops at its first fatal error, so there's
+// no meaningful way to match the two formats against each other.
+//
+// Cases that probe algorithms this parser doesn't implement (e.g. <template>
+// contents as a separate document, or reconstructing misnested formatting
+// elements) are marked with the non-standard #known-failure section instead
+// of being omitted; they run and are reported as documented gaps rather than
+// silently missing from the corpus. See template.dat and reconstruction.dat.
+func TestHTML5Lib(t *testing.T) {
+	files, err := filepath.Glob("testdata/html5lib-tests/*.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		file := file
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			cases, err := html5libtest.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, c := range cases {
+				c := c
+				t.Run(testName(i, c), func(t *testing.T) {
+					// #script-on/#script-off only affects cases where it's
+					// actually present; otherwise Scripting defaults to false.
+					opts := ParseOptions{Scripting: c.HasScript && c.Script}
+
+					if c.Fragment != "" {
+						ns, tag := html5libtest.ParseContext(c.Fragment)
+						context := &html.Node{
+							Type:      html.ElementNode,
+							Data:      tag,
+							DataAtom:  atom.Lookup([]byte(tag)),
+							Namespace: ns,
+						}
+
+						children, err := opts.ParseFragment(context, []byte(c.Data))
+						if err != nil {
+							reportResult(t, c, "", err)
+							return
+						}
+						reportResult(t, c, html5libtest.SerializeFragment(children), nil)
+						return
+					}
+
+					doc := &html.Node{Type: html.DocumentNode}
+					err := opts.Parse(doc, []byte(c.Data))
+					if err != nil {
+						reportResult(t, c, "", err)
+						return
+					}
+					reportResult(t, c, html5libtest.Serialize(doc), nil)
+				})
+			}
+		})
+	}
+}
+
+// reportResult compares a parse attempt's outcome (got, parseErr) against
+// case c's expectations. For an ordinary case, a parse error is fatal and the
+// tree dump must match c.Document exactly. For a case marked #known-failure,
+// neither is required to succeed: the case is expected to currently fail, so
+// a mismatch or error is reported via t.Log as a documented gap rather than
+// failing the build; if it unexpectedly passes, that's reported as a failure
+// so the stale #known-failure annotation gets noticed and removed.
+func reportResult(t *testing.T, c html5libtest.Case, got string, parseErr error) {
+	t.Helper()
+
+	if c.KnownFailure == "" {
+		if parseErr != nil {
+			t.Fatalf("Parse: %v", parseErr)
+		}
+		if got != c.Document {
+			t.Errorf("tree mismatch\ndata: %s\nexpected:\n%s\ngot:\n%s", c.Data, c.Document, got)
+		}
+		return
+	}
+
+	if parseErr == nil && got == c.Document {
+		t.Errorf("case passes despite #known-failure %q; remove the annotation", c.KnownFailure)
+		return
+	}
+	if parseErr != nil {
+		t.Logf("known failure (%s): Parse: %v", c.KnownFailure, parseErr)
+	} else {
+		t.Logf("known failure (%s)\ndata: %s\nexpected:\n%s\ngot:\n%s", c.KnownFailure, c.Data, c.Document, got)
+	}
+}
+
+func testName(i int, c html5libtest.Case) string {
+	if c.Fragment != "" {
+		return fmt.Sprintf("fragment-%d", i)
+	}
+	return fmt.Sprintf("case-%d", i)
+}
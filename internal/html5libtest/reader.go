@@ -0,0 +1,118 @@
+// Package html5libtest reads test cases in the html5lib-tests ".dat" format,
+// as used by the tree-construction conformance suite at
+// https://github.com/html5lib/html5lib-tests.
+package html5libtest
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Case is a single test case parsed out of a ".dat" file.
+type Case struct {
+	Data      string   // Raw HTML source, from #data
+	Errors    []string // Expected error messages, from #errors; parsed for upstream fidelity, but not compared by the test runner
+	Fragment  string   // Context element for #document-fragment, e.g. "body" or "svg path"; empty if not a fragment case
+	HasScript bool     // Whether #script-on or #script-off was present
+	Script    bool     // Value of the #script-on/#script-off directive
+	Document  string   // Expected serialized tree, from #document
+
+	// KnownFailure, from the non-standard #known-failure section, is a short
+	// reason (possibly spanning several lines) this case is expected to fail
+	// against the current parser (e.g. a missing algorithm). When set, the
+	// test runner records the case as a documented gap instead of requiring
+	// Document to match.
+	KnownFailure string
+}
+
+// ParseContext splits a #document-fragment context string, such as "body" or
+// "svg path", into a namespace ("" or "svg"/"math") and a local tag name.
+func ParseContext(s string) (namespace, tag string) {
+	if i := strings.IndexByte(s, ' '); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return "", s
+}
+
+// ReadFile parses every test case out of the ".dat" file at path.
+func ReadFile(path string) ([]Case, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var cases []Case
+	var cur *Case
+	var section string
+	var buf []string
+
+	flush := func() {
+		if cur == nil || section == "" {
+			return
+		}
+		// The blank line separating this section from the next one (or from
+		// the next #data) ends up appended to buf; drop it so it doesn't
+		// become a spurious trailing "\n" in the joined text.
+		if n := len(buf); n > 0 && buf[n-1] == "" {
+			buf = buf[:n-1]
+		}
+		text := strings.Join(buf, "\n")
+		switch section {
+		case "data":
+			cur.Data = text
+		case "errors":
+			if text != "" {
+				cur.Errors = strings.Split(text, "\n")
+			}
+		case "document-fragment":
+			cur.Fragment = strings.TrimSpace(text)
+		case "document":
+			cur.Document = text
+		case "known-failure":
+			cur.KnownFailure = strings.TrimSpace(text)
+		}
+		buf = buf[:0]
+	}
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := sc.Text()
+		switch line {
+		case "#data":
+			flush()
+			if cur != nil {
+				cases = append(cases, *cur)
+			}
+			cur = &Case{}
+			section = "data"
+			continue
+		case "#errors", "#document-fragment", "#document", "#known-failure":
+			flush()
+			section = line[1:]
+			continue
+		case "#script-on", "#script-off":
+			flush()
+			if cur == nil {
+				return nil, fmt.Errorf("%s: %s outside of a test case", path, line)
+			}
+			cur.HasScript = true
+			cur.Script = line == "#script-on"
+			section = ""
+			continue
+		}
+		buf = append(buf, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	if cur != nil {
+		cases = append(cases, *cur)
+	}
+
+	return cases, nil
+}
@@ -0,0 +1,86 @@
+package html5libtest
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Serialize renders the children of root using the indented tree-dump format
+// used by the #document section of html5lib-tests cases.
+func Serialize(root *html.Node) string {
+	b := &strings.Builder{}
+	for c := root.FirstChild; c != nil; c = c.NextSibling {
+		serializeNode(b, c, 0)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// SerializeFragment renders a list of top-level nodes, such as those
+// returned by ParseFragment, in the same format as Serialize.
+func SerializeFragment(nodes []*html.Node) string {
+	b := &strings.Builder{}
+	for _, n := range nodes {
+		serializeNode(b, n, 0)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func serializeNode(b *strings.Builder, n *html.Node, depth int) {
+	indent := "| " + strings.Repeat("  ", depth)
+
+	switch n.Type {
+	case html.TextNode:
+		b.WriteString(indent)
+		b.WriteByte('"')
+		b.WriteString(n.Data)
+		b.WriteString("\"\n")
+		return
+
+	case html.CommentNode:
+		b.WriteString(indent)
+		b.WriteString("<!-- ")
+		b.WriteString(n.Data)
+		b.WriteString(" -->\n")
+		return
+
+	case html.DoctypeNode:
+		b.WriteString(indent)
+		b.WriteString("<!DOCTYPE ")
+		b.WriteString(n.Data)
+		b.WriteString(">\n")
+		return
+
+	case html.ElementNode:
+		b.WriteString(indent)
+		b.WriteByte('<')
+		if n.Namespace != "" {
+			b.WriteString(n.Namespace)
+			b.WriteByte(' ')
+		}
+		b.WriteString(n.Data)
+		b.WriteString(">\n")
+
+		attrs := append([]html.Attribute(nil), n.Attr...)
+		sort.Slice(attrs, func(i, j int) bool { return attrs[i].Key < attrs[j].Key })
+		for _, a := range attrs {
+			b.WriteString(indent)
+			b.WriteString("  ")
+			b.WriteString(a.Key)
+			b.WriteString("=\"")
+			b.WriteString(a.Val)
+			b.WriteString("\"\n")
+		}
+
+	default:
+		b.WriteString(indent)
+		b.WriteString(strconv.Itoa(int(n.Type)))
+		b.WriteByte('\n')
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		serializeNode(b, c, depth+1)
+	}
+}
@@ -1,39 +1,164 @@
-package htmlparse
+package html
 
 import (
 	"bytes"
-	"errors"
-	"fmt"
 
 	"golang.org/x/net/html"
 	"golang.org/x/net/html/atom"
 )
 
-func Parse(parent *html.Node, text []byte) error {
-	p := &parser{text: text}
+// ParseOptions holds settings that affect how Parse and ParseFragment
+// interpret their input.
+type ParseOptions struct {
+	// Scripting controls how <noscript> is parsed. When true, matching a
+	// browser with JS enabled, <noscript> is treated as raw text with a
+	// single text-node child. When false, it's treated as a normal element
+	// whose contents are parsed and inserted as real child nodes.
+	Scripting bool
+}
+
+// Parse parses text with the given options and appends the resulting nodes
+// to parent.
+func (opts ParseOptions) Parse(parent *html.Node, text []byte) error {
+	tok := &Tokenizer{buf: text, eof: true, line: 1, col: 1}
+	p := &parser{Tokenizer: tok, text: tok.window(), opts: opts}
 	return p.parse(parent, true)
 }
 
+// Parse parses text and appends the resulting nodes to parent, using the
+// default ParseOptions. It's equivalent to ParseOptions{}.Parse(parent, text).
+func Parse(parent *html.Node, text []byte) error {
+	return ParseOptions{}.Parse(parent, text)
+}
+
 type parser struct {
 	arena
-	text     []byte
+	*Tokenizer
+
+	text     []byte // the buffered window not yet consumed; always Tokenizer.window()
 	lowerBuf []byte
+
+	opts ParseOptions
+
+	// foreignNS is set to "svg" or "math" while parsing inside an SVG or
+	// MathML context, where tag and attribute names are case-sensitive and
+	// not looked up as HTML atoms, and new elements are tagged with the
+	// namespace. It's "" while parsing ordinary HTML.
+	foreignNS string
+}
+
+// advance consumes n bytes from the front of p.text.
+func (p *parser) advance(n int) {
+	p.consume(n)
+	p.text = p.window()
+}
+
+// advanceTo consumes however many bytes separate p.text from newText, which
+// must be a suffix of p.text — typically the remainder returned by
+// nextIdent/nextValue, or the trimmed text inside skipSpace.
+func (p *parser) advanceTo(newText []byte) {
+	p.advance(len(p.text) - len(newText))
+}
+
+// rewind undoes every advance since m was taken.
+func (p *parser) rewind(m mark) {
+	p.rewindTo(m)
+	p.text = p.window()
+}
+
+// need ensures at least n bytes are buffered in p.text, pulling more from
+// the underlying reader as needed, and reports whether that many bytes are
+// now available.
+func (p *parser) need(n int) bool {
+	for len(p.text) < n {
+		if !p.fill() {
+			return false
+		}
+		p.text = p.window()
+	}
+	return true
+}
+
+// skipSpace advances past a run of whitespace at the front of p.text,
+// pulling in more input as needed. Unlike trimming p.text directly, this
+// correctly skips a whitespace run that happens to span a fill boundary,
+// rather than stopping at whatever was buffered when it was called.
+func (p *parser) skipSpace() {
+	for {
+		p.advanceTo(bytes.TrimLeftFunc(p.text, whitespaceF))
+		if len(p.text) > 0 || !p.fill() {
+			return
+		}
+		p.text = p.window()
+	}
+}
+
+// indexByte is bytes.IndexByte(p.text, c), pulling more input as needed when
+// c isn't found in what's currently buffered.
+func (p *parser) indexByte(c byte) int {
+	for {
+		if idx := bytes.IndexByte(p.text, c); idx >= 0 {
+			return idx
+		}
+		if !p.fill() {
+			return -1
+		}
+		p.text = p.window()
+	}
+}
+
+// index is bytes.Index(p.text, sub), pulling more input as needed.
+func (p *parser) index(sub []byte) int {
+	for {
+		if idx := bytes.Index(p.text, sub); idx >= 0 {
+			return idx
+		}
+		if !p.fill() {
+			return -1
+		}
+		p.text = p.window()
+	}
+}
+
+// indexFunc is bytes.IndexFunc(p.text, f), pulling more input as needed.
+func (p *parser) indexFunc(f func(rune) bool) int {
+	for {
+		if idx := bytes.IndexFunc(p.text, f); idx >= 0 {
+			return idx
+		}
+		if !p.fill() {
+			return -1
+		}
+		p.text = p.window()
+	}
+}
+
+// fireTopLevel invokes OnElementClose for node if it's a direct child of the
+// document root (root is true) and a callback is set.
+func (p *parser) fireTopLevel(root bool, node *html.Node) error {
+	if !root || p.OnElementClose == nil {
+		return nil
+	}
+	return p.OnElementClose(node)
 }
 
-// TODO: position information in errors
 func (p *parser) parse(parent *html.Node, root bool) error {
 	for {
-		idx := bytes.IndexByte(p.text, '<')
+		idx := p.indexByte('<')
 		if idx < 0 {
 			break
 		}
 
 		// Process preceding p.text
-		p.textNode(parent, p.text[:idx])
-		p.text = p.text[idx:]
+		if tn := p.textNode(parent, p.text[:idx]); tn != nil {
+			if err := p.fireTopLevel(root, tn); err != nil {
+				return err
+			}
+		}
+		p.advance(idx)
 
-		if len(p.text) < 2 {
-			return errors.New("Unexpected end of file in opening tag")
+		if !p.need(2) {
+			return p.errorf(parent.Data, "Unexpected end of file in opening tag")
 		}
 
 		switch p.text[1] {
@@ -49,16 +174,19 @@ func (p *parser) parse(parent *html.Node, root bool) error {
 			if selfClosing {
 				// Allow self-closing for any node type
 				// This is not spec-compliant, but is normally fine and means we can mostly not worry about foreign nodes
+				if err := p.fireTopLevel(root, node); err != nil {
+					return err
+				}
 				break
 			}
 
-			switch categorize(node.DataAtom) {
+			switch p.categorize(node.DataAtom) {
 			case catVoid:
 				// Do nothing
 			case catRaw:
-				err = p.parseRaw(node, false)
+				err = p.parseRaw(node, false, false)
 			case catEscapableRaw:
-				err = p.parseRaw(node, true)
+				err = p.parseRaw(node, true, false)
 			case catNormal, catTemplate, catForeign:
 				err = p.parse(node, false)
 			default:
@@ -67,6 +195,9 @@ func (p *parser) parse(parent *html.Node, root bool) error {
 			if err != nil {
 				return err
 			}
+			if err := p.fireTopLevel(root, node); err != nil {
+				return err
+			}
 
 		case '/':
 			// Closing tag
@@ -83,106 +214,134 @@ func (p *parser) parse(parent *html.Node, root bool) error {
 			if ok {
 				return nil
 			} else {
-				return fmt.Errorf("Unclosed %q element", parent.Data)
+				return p.errorf(parent.Data, "Unclosed %q element", parent.Data)
 			}
 
 		case '!':
-			p.text = p.text[2:]
-			if len(p.text) == 0 {
-				return errors.New("Unexpected end of file in comment tag")
+			p.advance(2)
+			if !p.need(1) {
+				return p.errorf(parent.Data, "Unexpected end of file in comment tag")
 			}
 			node := p.newNode()
 			node.Type = html.CommentNode
 			if bytes.HasPrefix(p.text, []byte("--")) {
 				// Well-formed comment
-				p.text = p.text[2:]
-				idx = bytes.Index(p.text, []byte("-->"))
-				node.Data, p.text = string(p.text[:idx]), p.text[idx+3:]
+				p.advance(2)
+				idx = p.index([]byte("-->"))
+				node.Data = string(p.text[:idx])
+				p.advance(idx + 3)
 			} else {
-				doctype, _, rest := p.nextIdent(p.text)
+				doctype, _, rest := p.nextIdent()
 				if doctype == "doctype" {
 					// DOCTYPE
-					p.text = skipSpace(rest)
-					idx = bytes.IndexByte(p.text, '>')
+					p.advanceTo(rest)
+					p.skipSpace()
+					idx = p.indexByte('>')
 					node.Type = html.DoctypeNode
-					node.Data, p.text = string(p.text[:idx]), p.text[idx+1:]
+					node.Data = string(p.text[:idx])
+					p.advance(idx + 1)
 				} else {
 					// Malformed comment
-					idx = bytes.IndexByte(p.text, '>')
-					node.Data, p.text = string(p.text[:idx]), p.text[idx+1:]
+					idx = p.indexByte('>')
+					node.Data = string(p.text[:idx])
+					p.advance(idx + 1)
 				}
 			}
 			parent.AppendChild(node)
+			if err := p.fireTopLevel(root, node); err != nil {
+				return err
+			}
 		}
 	}
 
 	if !root {
-		return fmt.Errorf("Unclosed %q element", parent.Data)
+		return p.errorf(parent.Data, "Unclosed %q element", parent.Data)
+	}
+	if tn := p.textNode(parent, p.text); tn != nil {
+		if err := p.fireTopLevel(root, tn); err != nil {
+			return err
+		}
 	}
-	p.textNode(parent, p.text)
 	return nil
 }
 
-func (p *parser) parseRaw(parent *html.Node, escapable bool) error {
+func (p *parser) parseRaw(parent *html.Node, escapable, fragment bool) error {
 	buf := &bytes.Buffer{}
 	for {
-		idx := bytes.IndexByte(p.text, '<')
+		idx := p.indexByte('<')
 		if idx < 0 {
-			return fmt.Errorf("Unclosed %q element", parent.Data)
+			if !fragment {
+				return p.errorf(parent.Data, "Unclosed %q element", parent.Data)
+			}
+			// A fragment's text never includes context's own closing tag, so
+			// running out of input just means the raw text ends here.
+			buf.Write(p.text)
+			p.advance(len(p.text))
+			break
 		}
 
 		// Process preceding p.text
 		buf.Write(p.text[:idx])
-		p.text = p.text[idx:]
+		p.advance(idx)
 
-		if len(p.text) < 2 {
-			return errors.New("Unexpected end of file in opening tag")
+		if !p.need(2) {
+			return p.errorf(parent.Data, "Unexpected end of file in opening tag")
 		}
 
 		if p.text[1] == '/' {
 			// Check for a closing tag
-			oldText := p.text
+			m := p.mark()
 			ok, err := p.parseEndTag(parent)
 			if err != nil {
 				return err
 			}
 
 			if ok {
-				if escapable {
-					p.textNode(parent, buf.Bytes())
-				} else if buf.Len() > 0 {
-					node := p.newNode()
-					node.Type = html.TextNode
-					node.Data = buf.String()
-					parent.AppendChild(node)
-				}
-				return nil
-			} else {
-				// Reset the text
-				p.text = oldText
+				p.commit()
+				break
 			}
+			// Not actually the closing tag; treat the '<' as raw text instead.
+			p.rewind(m)
 		}
 
 		buf.Write(p.text[:2])
-		p.text = p.text[2:]
+		p.advance(2)
 	}
-}
 
-func (p *parser) textNode(parent *html.Node, text []byte) {
-	if len(text) > 0 {
+	if escapable {
+		p.textNode(parent, buf.Bytes())
+	} else if buf.Len() > 0 {
 		node := p.newNode()
 		node.Type = html.TextNode
-		node.Data = html.UnescapeString(string(text))
+		node.Data = buf.String()
 		parent.AppendChild(node)
 	}
+	return nil
+}
+
+// textNode appends a text node holding text to parent, returning it, or
+// returns nil if text is empty.
+func (p *parser) textNode(parent *html.Node, text []byte) *html.Node {
+	if len(text) == 0 {
+		return nil
+	}
+	node := p.newNode()
+	node.Type = html.TextNode
+	node.Data = html.UnescapeString(string(text))
+	parent.AppendChild(node)
+	return node
 }
 
 func (p *parser) parseStartTag() (node *html.Node, selfClosing bool, err error) {
-	p.text = skipSpace(p.text[1:])
-	elemS, elemA, rest := p.nextIdent(p.text)
-	p.text = rest
+	p.advance(1)
+	p.skipSpace()
+	elemS, elemA, rest := p.nextIdent()
+	p.advanceTo(rest)
 	if elemS == "" {
-		return nil, false, fmt.Errorf("Unexpected %q in opening tag", p.text[0])
+		if !p.need(1) {
+			return nil, false, p.errorf("", "Unexpected end of file in opening tag")
+		}
+		return nil, false, p.errorf("", "Unexpected %q in opening tag", p.text[0])
 	}
 
 	// Construct node
@@ -190,24 +349,37 @@ func (p *parser) parseStartTag() (node *html.Node, selfClosing bool, err error)
 	node.Type = html.ElementNode
 	node.Data = elemS
 	node.DataAtom = elemA
+	node.Namespace = p.foreignNS
 
 	// Attributes
-	p.text = skipSpace(p.text)
+	p.skipSpace()
+	if !p.need(1) {
+		return nil, false, p.errorf(node.Data, "Unexpected end of file in opening %q tag", node.Data)
+	}
 	for p.text[0] != '/' && p.text[0] != '>' {
 		var name, val string
 		// Name
-		name, _, p.text = p.nextIdent(p.text)
+		name, _, rest = p.nextIdent()
+		p.advanceTo(rest)
 		if name == "" {
-			return nil, false, fmt.Errorf("Unexpected %q in opening %q tag", p.text[0], node.Data)
+			return nil, false, p.errorf(node.Data, "Unexpected %q in opening %q tag", p.text[0], node.Data)
 		}
 
 		// Value
-		p.text = skipSpace(p.text)
+		p.skipSpace()
+		if !p.need(1) {
+			return nil, false, p.errorf(node.Data, "Unexpected end of file in opening %q tag", node.Data)
+		}
 		if p.text[0] == '=' {
-			p.text = skipSpace(p.text[1:])
-			val, p.text = p.nextValue(p.text)
+			p.advance(1)
+			p.skipSpace()
+			if !p.need(1) {
+				return nil, false, p.errorf(node.Data, "Unexpected end of file in opening %q tag", node.Data)
+			}
+			val, rest = p.nextValue()
+			p.advanceTo(rest)
 		}
-		p.text = skipSpace(p.text)
+		p.skipSpace()
 
 		// Construct attribute
 		node.Attr = append(node.Attr, html.Attribute{
@@ -215,40 +387,55 @@ func (p *parser) parseStartTag() (node *html.Node, selfClosing bool, err error)
 			Val: val,
 		})
 
-		p.text = skipSpace(p.text)
+		p.skipSpace()
+		if !p.need(1) {
+			return nil, false, p.errorf(node.Data, "Unexpected end of file in opening %q tag", node.Data)
+		}
 	}
 
 	if p.text[0] == '/' {
 		selfClosing = true
 
-		p.text = skipSpace(p.text[1:])
-		if p.text[0] != '>' {
-			return nil, false, fmt.Errorf("Unexpected '/' in opening %q tag", node.Data)
+		p.advance(1)
+		p.skipSpace()
+		if !p.need(1) || p.text[0] != '>' {
+			return nil, false, p.errorf(node.Data, "Unexpected '/' in opening %q tag", node.Data)
 		}
 	}
 	// Skip over '>'
-	p.text = p.text[1:]
+	p.advance(1)
 
 	return node, selfClosing, nil
 }
 
 func (p *parser) parseEndTag(start *html.Node) (ok bool, err error) {
-	p.text = p.text[2:]
-	elemS, elemA, rest := p.nextIdent(p.text)
-	p.text = rest
+	element := ""
+	if start != nil {
+		element = start.Data
+	}
+
+	p.advance(2)
+	elemS, elemA, rest := p.nextIdent()
+	p.advanceTo(rest)
 	if elemS == "" {
-		return false, fmt.Errorf("Unexpected %q in closing tag", p.text[0])
+		if !p.need(1) {
+			return false, p.errorf(element, "Unexpected end of file in closing tag")
+		}
+		return false, p.errorf(element, "Unexpected %q in closing tag", p.text[0])
 	}
 	if start == nil || elemA != start.DataAtom || (elemA == 0 && elemS != start.Data) {
 		return false, nil
 	}
 
-	p.text = skipSpace(p.text)
+	p.skipSpace()
+	if !p.need(1) {
+		return false, p.errorf(elemS, "Unexpected end of file in closing %q tag", elemS)
+	}
 	if p.text[0] != '>' {
-		return false, fmt.Errorf("Unexpected %q in closing %q tag", p.text[0], elemS)
+		return false, p.errorf(elemS, "Unexpected %q in closing %q tag", p.text[0], elemS)
 	}
 	// Skip over '>'
-	p.text = p.text[1:]
+	p.advance(1)
 
 	return true, nil
 }
@@ -263,10 +450,6 @@ func unquotInvalidF(r rune) bool {
 	return whitespaceF(r) || r == 0 || r == '"' || r == '\'' || r == '=' || r == '<' || r == '>'
 }
 
-func skipSpace(text []byte) []byte {
-	return bytes.TrimLeftFunc(text, whitespaceF)
-}
-
 // asciiLower returns a copy of text with all uppercase ascii letters converted to lowercase.
 // The returned slice is only valid until the next call to asciiLower.
 func (p *parser) asciiLower(text []byte) []byte {
@@ -289,11 +472,25 @@ func (p *parser) asciiLower(text []byte) []byte {
 	return p.lowerBuf
 }
 
-func (p *parser) nextIdent(text []byte) (string, atom.Atom, []byte) {
-	idx := bytes.IndexFunc(text, identInvalidF)
-	identB, text := text[:idx], text[idx:]
+// nextIdent reads an identifier (a tag or attribute name) from the front of
+// p.text, without consuming it; the caller commits to the read via
+// advanceTo(rest) once it knows whether to accept it.
+func (p *parser) nextIdent() (string, atom.Atom, []byte) {
+	idx := p.indexFunc(identInvalidF)
+	if idx < 0 {
+		// Ran all the way to EOF without finding a terminator; treat
+		// whatever's left as the identifier.
+		idx = len(p.text)
+	}
+	identB, rest := p.text[:idx], p.text[idx:]
 	if len(identB) == 0 {
-		return "", 0, text
+		return "", 0, rest
+	}
+
+	if p.foreignNS != "" {
+		// SVG and MathML names are case-sensitive (e.g. viewBox, textPath) and
+		// aren't part of the HTML atom table, so leave them alone.
+		return string(identB), 0, rest
 	}
 
 	identB = p.asciiLower(identB)
@@ -302,17 +499,40 @@ func (p *parser) nextIdent(text []byte) (string, atom.Atom, []byte) {
 	if identA == 0 {
 		identS = string(identB)
 	}
-	return identS, identA, text
+	return identS, identA, rest
 }
 
-func (p *parser) nextValue(text []byte) (string, []byte) {
-	if text[0] == '\'' || text[0] == '"' {
-		delim, text := text[0], text[1:]
-		idx := bytes.IndexByte(text, delim)
-		return string(text[:idx]), text[idx+1:]
-	} else {
-		idx := bytes.IndexFunc(text, unquotInvalidF)
-		return string(text[:idx]), text[idx:]
+// nextValue reads an attribute value from the front of p.text, without
+// consuming it; see nextIdent.
+func (p *parser) nextValue() (string, []byte) {
+	if p.text[0] == '\'' || p.text[0] == '"' {
+		delim := p.text[0]
+		idx := p.indexByteFrom(1, delim)
+		if idx < 0 {
+			// Unterminated quoted value; treat the rest of the input as the value.
+			return string(p.text[1:]), p.text[len(p.text):]
+		}
+		return string(p.text[1:idx]), p.text[idx+1:]
+	}
+
+	idx := p.indexFunc(unquotInvalidF)
+	if idx < 0 {
+		idx = len(p.text)
+	}
+	return string(p.text[:idx]), p.text[idx:]
+}
+
+// indexByteFrom is indexByte, but starts searching at offset from rather
+// than the start of p.text.
+func (p *parser) indexByteFrom(from int, c byte) int {
+	for {
+		if idx := bytes.IndexByte(p.text[from:], c); idx >= 0 {
+			return from + idx
+		}
+		if !p.fill() {
+			return -1
+		}
+		p.text = p.window()
 	}
 }
 
@@ -342,3 +562,12 @@ func categorize(a atom.Atom) category {
 		return catNormal
 	}
 }
+
+// categorize is like the categorize function, but resolves atom.Noscript
+// according to p.opts.Scripting instead of always treating it as normal.
+func (p *parser) categorize(a atom.Atom) category {
+	if a == atom.Noscript && p.opts.Scripting {
+		return catRaw
+	}
+	return categorize(a)
+}
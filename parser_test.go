@@ -2,6 +2,7 @@ package html
 
 import (
 	"bytes"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -9,6 +10,7 @@ import (
 	"testing"
 
 	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
 // Parse the test data, render it, then compare to the expected string.
@@ -96,6 +98,137 @@ func TestDoctype(t *testing.T) {
 	testParseRen(t, `<!doctype html "foo bar">`, `<!DOCTYPE html "foo bar">`)
 }
 
+func TestErrorPosition(t *testing.T) {
+	doc := &html.Node{Type: html.DocumentNode}
+	err := Parse(doc, []byte("<a>\n<b =>"))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	perr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("expected *Error, got %T", err)
+	}
+	if perr.Line != 2 || perr.Col != 4 {
+		t.Errorf("wrong position: got line %d col %d, want line 2 col 4", perr.Line, perr.Col)
+	}
+	if perr.Element != "b" {
+		t.Errorf("wrong element: got %q, want %q", perr.Element, "b")
+	}
+}
+
+func TestNoscript(t *testing.T) {
+	src := `<noscript><p>hi</p></noscript>`
+
+	doc := &html.Node{Type: html.DocumentNode}
+	if err := (ParseOptions{Scripting: false}).Parse(doc, []byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	noscript := doc.FirstChild
+	if noscript.FirstChild == nil || noscript.FirstChild.Type != html.ElementNode {
+		t.Errorf("with scripting disabled, expected <noscript> to have an element child, got %+v", noscript.FirstChild)
+	}
+
+	doc = &html.Node{Type: html.DocumentNode}
+	if err := (ParseOptions{Scripting: true}).Parse(doc, []byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	noscript = doc.FirstChild
+	if noscript.FirstChild == nil || noscript.FirstChild.Type != html.TextNode || noscript.FirstChild.NextSibling != nil {
+		t.Errorf("with scripting enabled, expected <noscript> to have a single text child, got %+v", noscript.FirstChild)
+	}
+}
+
+func TestNoscriptFragment(t *testing.T) {
+	context := &html.Node{Type: html.ElementNode, Data: "noscript", DataAtom: atom.Noscript}
+	src := `<p>hi</p>`
+
+	children, err := (ParseOptions{Scripting: false}).ParseFragment(context, []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(children) != 1 || children[0].Type != html.ElementNode {
+		t.Errorf("with scripting disabled, expected a single element child, got %+v", children)
+	}
+
+	children, err = (ParseOptions{Scripting: true}).ParseFragment(context, []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(children) != 1 || children[0].Type != html.TextNode {
+		t.Errorf("with scripting enabled, expected a single text child, got %+v", children)
+	}
+}
+
+func TestForeignFragmentNamespace(t *testing.T) {
+	context := &html.Node{Type: html.ElementNode, Data: "svg", DataAtom: atom.Svg, Namespace: "svg"}
+	children, err := ParseFragment(context, []byte(`<path d="M0 0"/>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(children) != 1 || children[0].Namespace != "svg" {
+		t.Errorf("expected a child tagged with the svg namespace, got %+v", children)
+	}
+}
+
+// chunkReader drip-feeds src one byte at a time, to force the tokenizer
+// through repeated fill/compact cycles instead of reading it all at once.
+type chunkReader struct{ src []byte }
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.src) == 0 {
+		return 0, io.EOF
+	}
+	p[0] = r.src[0]
+	r.src = r.src[1:]
+	return 1, nil
+}
+
+func TestParseReader(t *testing.T) {
+	doc := &html.Node{Type: html.DocumentNode}
+	src := `<a>1</a><b>2</b><a>3<a>4</a></a>`
+	if err := ParseReader(doc, &chunkReader{[]byte(src)}); err != nil {
+		t.Fatal(err)
+	}
+
+	b := &bytes.Buffer{}
+	html.Render(b, doc)
+	if b.String() != src {
+		t.Errorf("Source and rendered do not match\nExpected: %q\nRendered: %q", src, b.String())
+	}
+}
+
+// TestParseReaderSpaceBeforeValue guards against a panic when the buffered
+// window runs out right after the whitespace between "=" and an attribute
+// value, which a slow or chunked io.Reader can easily trigger.
+func TestParseReaderSpaceBeforeValue(t *testing.T) {
+	doc := &html.Node{Type: html.DocumentNode}
+	src := `<a foo=   "bar"></a>`
+	if err := ParseReader(doc, &chunkReader{[]byte(src)}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTokenizerOnElementClose(t *testing.T) {
+	doc := &html.Node{Type: html.DocumentNode}
+	tok := NewTokenizer(&chunkReader{[]byte(`1<a>2</a>3<b>4</b>`)})
+
+	var closed []string
+	tok.OnElementClose = func(n *html.Node) error {
+		if n.Type == html.ElementNode {
+			closed = append(closed, n.Data)
+		}
+		return nil
+	}
+
+	if err := tok.Parse(doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(closed) != 2 || closed[0] != "a" || closed[1] != "b" {
+		t.Errorf("wrong elements reported closed: %v, want [a b]", closed)
+	}
+}
+
 // Benchmarks
 func benchmarkParser(b *testing.B, fun func(b *testing.B, source []byte)) {
 	b.Helper()
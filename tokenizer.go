@@ -0,0 +1,137 @@
+package html
+
+import (
+	"io"
+
+	"golang.org/x/net/html"
+)
+
+// Tokenizer buffers input read incrementally from an io.Reader so Parse's
+// logic can run directly against a stream — an HTTP response body, say —
+// without first reading the whole document into memory.
+//
+// Internally it keeps a growable buffer of bytes read but not yet consumed
+// by the parser. Once more than half of that buffer has been consumed, the
+// consumed prefix is discarded and the remainder shifted down, so the
+// buffer only grows as large as the longest unconsumed span actually
+// requires (e.g. the biggest single tag or run of text), not the size of
+// the whole document.
+type Tokenizer struct {
+	r   io.Reader
+	buf []byte // bytes read so far; buf[pos:] is unconsumed
+	pos int
+	eof bool
+
+	marks int // outstanding mark() calls; pauses compaction while nonzero
+
+	offset int // total bytes consumed so far
+	line   int // 1-based line of the next unconsumed byte
+	col    int // 1-based column of the next unconsumed byte
+
+	// OnElementClose, if set before Parse is called, is invoked each time a
+	// direct child of Parse's parent finishes — its closing tag is seen, or
+	// it self-closes, or (for text/comment/doctype nodes) it's appended.
+	// This lets a streaming consumer process and discard top-level nodes,
+	// e.g. <article> entries in a feed, as they complete rather than
+	// holding the whole document tree in memory until parsing finishes.
+	//
+	// Nodes are allocated out of the arena in alloc.go, which frees whole
+	// blocks at a time; a discarded node's block isn't reclaimed until
+	// every other node allocated alongside it is also unreachable.
+	OnElementClose func(*html.Node) error
+
+	// Options, if set before Parse is called, controls parsing behaviour the
+	// same way it does for Parse and ParseFragment.
+	Options ParseOptions
+}
+
+// NewTokenizer returns a Tokenizer that reads from r as the parser demands
+// more input.
+func NewTokenizer(r io.Reader) *Tokenizer {
+	return &Tokenizer{r: r, line: 1, col: 1}
+}
+
+// Parse parses HTML read from the tokenizer's reader and appends the
+// resulting nodes to parent.
+func (t *Tokenizer) Parse(parent *html.Node) error {
+	p := &parser{Tokenizer: t, text: t.window(), opts: t.Options}
+	return p.parse(parent, true)
+}
+
+// ParseReader parses HTML read from r and appends the resulting nodes to
+// parent, without buffering the whole input up front. It's equivalent to
+// NewTokenizer(r).Parse(parent) for callers that don't need OnElementClose.
+func ParseReader(parent *html.Node, r io.Reader) error {
+	return NewTokenizer(r).Parse(parent)
+}
+
+func (t *Tokenizer) window() []byte { return t.buf[t.pos:] }
+
+// fill reads more data from the underlying reader, growing or compacting
+// buf as needed. It reports whether any more data is now available.
+func (t *Tokenizer) fill() bool {
+	if t.eof {
+		return false
+	}
+
+	if t.marks == 0 && t.pos > 0 && (len(t.buf) == cap(t.buf) || t.pos > len(t.buf)/2) {
+		n := copy(t.buf, t.buf[t.pos:])
+		t.buf = t.buf[:n]
+		t.pos = 0
+	}
+	if len(t.buf) == cap(t.buf) {
+		grown := make([]byte, len(t.buf), growCap(cap(t.buf)))
+		copy(grown, t.buf)
+		t.buf = grown
+	}
+
+	n, err := t.r.Read(t.buf[len(t.buf):cap(t.buf)])
+	t.buf = t.buf[:len(t.buf)+n]
+	if err != nil {
+		t.eof = true
+	}
+	return n > 0
+}
+
+func growCap(c int) int {
+	if c < 4096 {
+		return 4096
+	}
+	return c * 2
+}
+
+// consume advances past the first n bytes of the unconsumed window,
+// tracking line and column as it goes.
+func (t *Tokenizer) consume(n int) {
+	for _, b := range t.buf[t.pos : t.pos+n] {
+		if b == '\n' {
+			t.line++
+			t.col = 1
+		} else {
+			t.col++
+		}
+	}
+	t.pos += n
+	t.offset += n
+}
+
+// mark is a saved position that rewind can later return to.
+type mark struct {
+	pos, offset, line, col int
+}
+
+func (t *Tokenizer) mark() mark {
+	t.marks++
+	return mark{t.pos, t.offset, t.line, t.col}
+}
+
+// commit releases a mark without rewinding to it, once it's known it won't
+// be needed for backtracking after all.
+func (t *Tokenizer) commit() {
+	t.marks--
+}
+
+func (t *Tokenizer) rewindTo(m mark) {
+	t.marks--
+	t.pos, t.offset, t.line, t.col = m.pos, m.offset, m.line, m.col
+}